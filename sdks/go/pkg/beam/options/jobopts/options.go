@@ -19,13 +19,19 @@ package jobopts
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var (
@@ -47,8 +53,171 @@ var (
 	// InternalJavaRunner is the java class needed at this time for Java runners.
 	// To be removed.
 	InternalJavaRunner = flag.String("internal_java_runner", "", "Internal java runner class.")
+
+	// EnvironmentType is the type of environment to run the SDK harness in:
+	// DOCKER, PROCESS or EXTERNAL. LOOPBACK is accepted as a value, but
+	// runnerlib.GetEnvironment returns an error for it.
+	EnvironmentType = flag.String("environment_type", "DOCKER", "Environment type: DOCKER, PROCESS, EXTERNAL, or LOOPBACK (optional).")
+
+	// EnvironmentConfig is environment-type-specific configuration, such as a
+	// PROCESS command line or an EXTERNAL endpoint, as a JSON string or a
+	// plain string depending on the environment type.
+	EnvironmentConfig = flag.String("environment_config", "", "Environment configuration, specific to environment_type (optional).")
+
+	// JobSubmitTimeout bounds how long Prepare/Run RPCs to the job service may
+	// block before the submission is treated as failed.
+	JobSubmitTimeout = flag.Duration("job_submit_timeout", 2*time.Minute, "Timeout for job submission RPCs such as Prepare and Run (optional).")
+
+	// MaxSubmitRetries bounds how many times a failed submission RPC is
+	// retried, with exponential backoff, before giving up.
+	MaxSubmitRetries = flag.Int("max_submit_retries", 3, "Maximum number of retries for job submission RPCs (optional).")
+
+	// RetryableCodes is a comma-separated list of gRPC status codes that
+	// WithRetry treats as retryable. runnerlib.PrepareJob uses WithRetry for
+	// its Prepare and Run RPCs; job state is not polled with it.
+	RetryableCodes = flag.String("retryable_codes", "UNAVAILABLE,DEADLINE_EXCEEDED", "Comma-separated list of gRPC status codes to retry on (optional).")
+
+	// SdkHarnessContainerImageOverrides replaces the SDK harness container
+	// image for environments whose id matches a regular expression. It may
+	// be repeated to configure distinct images for the environments present
+	// in a cross-language pipeline.
+	SdkHarnessContainerImageOverrides = containerImageOverrideList{}
+
+	// PipelineOptions is a repeatable "key=value" flag that is passed through
+	// to the runner as a pipeline option, for runner-specific knobs that have
+	// no dedicated jobopts flag.
+	PipelineOptions = pipelineOptionList{}
+
+	// PipelineOptionsFile is the path to a JSON file of pipeline options,
+	// merged underneath any options set with --pipeline_option.
+	PipelineOptionsFile = flag.String("pipeline_options_file", "", "Path to a JSON file of pipeline options to pass through to the runner (optional).")
+
+	// ArtifactEndpoint is the artifact staging service endpoint. If unset,
+	// Endpoint is used, since job services commonly serve both the
+	// JobService and ArtifactStagingService on the same endpoint.
+	ArtifactEndpoint = flag.String("artifact_endpoint", "", "Artifact staging endpoint (optional, defaults to --endpoint).")
+
+	// ArtifactStagingPath is the path or URL (e.g. a GCS, S3, or HDFS path)
+	// artifacts are staged from, for the "file" and "url" ArtifactTypes.
+	ArtifactStagingPath = flag.String("artifact_staging_path", "", "Shared filesystem path artifacts are staged from (optional).")
+
+	// RetrievalToken is the staging token returned by a prior artifact
+	// staging RPC, used to resume or finalize staging.
+	RetrievalToken = flag.String("retrieval_token", "", "Artifact retrieval token (optional).")
+
+	// ArtifactType selects how artifacts are made available to the runner:
+	// "file" references a file path (no bytes are sent to the artifact
+	// service by runnerlib), "url" references an
+	// HTTP(S) or filesystem URL, and "embedded" assumes the artifact is
+	// already present in the SDK harness container. Any other value is
+	// rejected at job submission time: the portable ArtifactInformation
+	// protocol has no generic "maven"/"pypi" artifact type urn, so those
+	// values can never be staged.
+	ArtifactType = flag.String("artifact_type", "file", "Artifact staging type: file, url, or embedded (optional).")
+
+	// DryRunArtifacts logs what would be staged instead of staging it.
+	DryRunArtifacts = flag.Bool("dry_run_artifacts", false, "Log what would be staged instead of staging artifacts.")
+
+	// JobCancelTimeout bounds how long to wait for the Cancel RPC sent by
+	// CancelJob or DrainJob to be acknowledged by the job service.
+	JobCancelTimeout = flag.Duration("job_cancel_timeout", 30*time.Second, "Timeout for job Cancel/Drain RPCs (optional).")
+
+	// EnableJobDrain changes only the message DrainJob logs: DrainJob sends
+	// the same Cancel RPC as CancelJob whether or not it is set, and no
+	// separate drain request is made.
+	EnableJobDrain = flag.Bool("enable_job_drain", false, "Allow draining a streaming job instead of cancelling it (optional).")
 )
 
+func init() {
+	flag.Var(&SdkHarnessContainerImageOverrides, "sdk_harness_container_image_override",
+		"Overrides the SDK harness container image for environments matching a regex, in the form \"env_id_regex,container_image\". May be repeated.")
+	flag.Var(&PipelineOptions, "pipeline_option",
+		"A runner-specific pipeline option, in the form \"key=value\". May be repeated.")
+}
+
+// ContainerImageOverride pairs an environment id regular expression with the
+// container image to use for matching environments.
+type ContainerImageOverride struct {
+	// Pattern is a regular expression matched against an environment's id.
+	Pattern string
+	// Image is the replacement container image.
+	Image string
+}
+
+// Matches reports whether envID matches the override's pattern.
+func (o ContainerImageOverride) Matches(envID string) (bool, error) {
+	return regexp.MatchString(o.Pattern, envID)
+}
+
+// containerImageOverrideList is a flag.Value that accumulates repeated
+// "pattern,image" values as ContainerImageOverride entries.
+type containerImageOverrideList []ContainerImageOverride
+
+func (l *containerImageOverrideList) String() string {
+	var parts []string
+	for _, o := range *l {
+		parts = append(parts, fmt.Sprintf("%v,%v", o.Pattern, o.Image))
+	}
+	return strings.Join(parts, ";")
+}
+
+func (l *containerImageOverrideList) Set(value string) error {
+	parts := strings.SplitN(value, ",", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid sdk_harness_container_image_override %q, want \"env_id_regex,image\"", value)
+	}
+	if _, err := regexp.Compile(parts[0]); err != nil {
+		return fmt.Errorf("invalid sdk_harness_container_image_override %q: %w", value, err)
+	}
+	*l = append(*l, ContainerImageOverride{Pattern: parts[0], Image: parts[1]})
+	return nil
+}
+
+// pipelineOptionList is a flag.Value that accumulates repeated "key=value"
+// values into a map, for use by GetPipelineOptions.
+type pipelineOptionList map[string]string
+
+func (l *pipelineOptionList) String() string {
+	var parts []string
+	for k, v := range *l {
+		parts = append(parts, fmt.Sprintf("%v=%v", k, v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *pipelineOptionList) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid pipeline_option %q, want \"key=value\"", value)
+	}
+	if *l == nil {
+		*l = make(pipelineOptionList)
+	}
+	(*l)[parts[0]] = parts[1]
+	return nil
+}
+
+// GetPipelineOptions returns the pipeline options supplied via
+// --pipeline_options_file and repeated --pipeline_option flags, merged into
+// a structpb.Struct suitable for PrepareJobRequest.pipeline_options.
+// Individual --pipeline_option flags take precedence over the file.
+func GetPipelineOptions() (*structpb.Struct, error) {
+	merged := make(map[string]interface{})
+	if *PipelineOptionsFile != "" {
+		data, err := ioutil.ReadFile(*PipelineOptionsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pipeline_options_file %q: %w", *PipelineOptionsFile, err)
+		}
+		if err := json.Unmarshal(data, &merged); err != nil {
+			return nil, fmt.Errorf("failed to parse pipeline_options_file %q: %w", *PipelineOptionsFile, err)
+		}
+	}
+	for k, v := range PipelineOptions {
+		merged[k] = v
+	}
+	return structpb.NewStruct(merged)
+}
+
 // GetEndpoint returns the endpoint, if non empty and exits otherwise. Runners
 // such as Dataflow set a reasonable default. Convenience function.
 func GetEndpoint() (string, error) {
@@ -78,6 +247,35 @@ func GetContainerImage(ctx context.Context) string {
 	return *ContainerImage
 }
 
+// GetContainerImageOverrides returns the parsed per-environment container
+// image overrides supplied via repeated
+// --sdk_harness_container_image_override flags.
+func GetContainerImageOverrides() []ContainerImageOverride {
+	return SdkHarnessContainerImageOverrides
+}
+
+// GetEnvironmentType returns the configured environment type, upper-cased
+// for comparison against the type names DOCKER, PROCESS, EXTERNAL and
+// LOOPBACK.
+func GetEnvironmentType() string {
+	return strings.ToUpper(*EnvironmentType)
+}
+
+// GetEnvironmentConfig returns the raw environment configuration string for
+// the configured environment type.
+func GetEnvironmentConfig(ctx context.Context) string {
+	return *EnvironmentConfig
+}
+
+// GetArtifactEndpoint returns the configured artifact staging endpoint, or,
+// if unset, falls back to the job service Endpoint.
+func GetArtifactEndpoint() string {
+	if *ArtifactEndpoint != "" {
+		return *ArtifactEndpoint
+	}
+	return *Endpoint
+}
+
 // GetExperiments returns the experiments.
 func GetExperiments() []string {
 	if *Experiments == "" {
@@ -85,3 +283,87 @@ func GetExperiments() []string {
 	}
 	return strings.Split(*Experiments, ",")
 }
+
+// GetCancelTimeout returns the configured deadline for a single Cancel RPC,
+// as sent by CancelJob and DrainJob.
+func GetCancelTimeout() time.Duration {
+	return *JobCancelTimeout
+}
+
+// GetSubmitTimeout returns the configured deadline for a single job
+// submission RPC, such as Prepare or Run.
+func GetSubmitTimeout() time.Duration {
+	return *JobSubmitTimeout
+}
+
+// codesByName maps the gRPC status code names accepted by --retryable_codes
+// (the google.rpc.Code SCREAMING_SNAKE_CASE spelling) to their codes.Code
+// value. codes.Code itself only exposes a String method, not a name table,
+// so this is spelled out explicitly.
+var codesByName = map[string]codes.Code{
+	"OK":                  codes.OK,
+	"CANCELLED":           codes.Canceled,
+	"UNKNOWN":             codes.Unknown,
+	"INVALID_ARGUMENT":    codes.InvalidArgument,
+	"DEADLINE_EXCEEDED":   codes.DeadlineExceeded,
+	"NOT_FOUND":           codes.NotFound,
+	"ALREADY_EXISTS":      codes.AlreadyExists,
+	"PERMISSION_DENIED":   codes.PermissionDenied,
+	"RESOURCE_EXHAUSTED":  codes.ResourceExhausted,
+	"FAILED_PRECONDITION": codes.FailedPrecondition,
+	"ABORTED":             codes.Aborted,
+	"OUT_OF_RANGE":        codes.OutOfRange,
+	"UNIMPLEMENTED":       codes.Unimplemented,
+	"INTERNAL":            codes.Internal,
+	"UNAVAILABLE":         codes.Unavailable,
+	"DATA_LOSS":           codes.DataLoss,
+	"UNAUTHENTICATED":     codes.Unauthenticated,
+}
+
+// getRetryableCodes parses RetryableCodes into gRPC status codes.
+func getRetryableCodes() map[codes.Code]bool {
+	ret := make(map[codes.Code]bool)
+	for _, c := range strings.Split(*RetryableCodes, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if code, ok := codesByName[c]; ok {
+			ret[code] = true
+		}
+	}
+	return ret
+}
+
+// WithRetry calls fn, retrying with exponential backoff up to
+// MaxSubmitRetries times if fn returns an error whose gRPC status code is in
+// RetryableCodes. Each call to fn is bounded by GetSubmitTimeout, so a single
+// hung Prepare or Run RPC cannot block submission indefinitely. It
+// returns the last error encountered if all attempts fail.
+func WithRetry(ctx context.Context, fn func(ctx context.Context) error) error {
+	retryable := getRetryableCodes()
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 0; attempt <= *MaxSubmitRetries; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, GetSubmitTimeout())
+		err = fn(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if !retryable[status.Code(err)] {
+			return err
+		}
+		if attempt == *MaxSubmitRetries {
+			break
+		}
+		log.Infof(ctx, "Retryable error submitting job (attempt %v/%v): %v", attempt+1, *MaxSubmitRetries+1, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+	return fmt.Errorf("job submission failed after %v retries: %w", *MaxSubmitRetries, err)
+}
@@ -0,0 +1,179 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobopts
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetRetryableCodes(t *testing.T) {
+	old := *RetryableCodes
+	defer func() { *RetryableCodes = old }()
+
+	*RetryableCodes = "UNAVAILABLE, deadline_exceeded"
+	got := getRetryableCodes()
+	if !got[codes.Unavailable] || !got[codes.DeadlineExceeded] {
+		t.Fatalf("getRetryableCodes() = %v, want UNAVAILABLE and DEADLINE_EXCEEDED set", got)
+	}
+	if got[codes.Internal] {
+		t.Fatalf("getRetryableCodes() = %v, want INTERNAL unset", got)
+	}
+}
+
+func TestWithRetry_RetriesRetryableCodes(t *testing.T) {
+	oldRetries, oldCodes := *MaxSubmitRetries, *RetryableCodes
+	defer func() { *MaxSubmitRetries, *RetryableCodes = oldRetries, oldCodes }()
+	*MaxSubmitRetries = 2
+	*RetryableCodes = "UNAVAILABLE"
+
+	attempts := 0
+	err := WithRetry(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return status.Error(codes.Unavailable, "try again")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRetry() = %v, want nil", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("WithRetry made %v attempts, want 3", attempts)
+	}
+}
+
+func TestWithRetry_NonRetryableFailsFast(t *testing.T) {
+	oldRetries, oldCodes := *MaxSubmitRetries, *RetryableCodes
+	defer func() { *MaxSubmitRetries, *RetryableCodes = oldRetries, oldCodes }()
+	*MaxSubmitRetries = 2
+	*RetryableCodes = "UNAVAILABLE"
+
+	attempts := 0
+	err := WithRetry(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return status.Error(codes.InvalidArgument, "bad request")
+	})
+	if err == nil {
+		t.Fatal("WithRetry() = nil, want error")
+	}
+	if attempts != 1 {
+		t.Fatalf("WithRetry made %v attempts, want 1 for a non-retryable error", attempts)
+	}
+}
+
+func TestContainerImageOverrideListSetString(t *testing.T) {
+	var l containerImageOverrideList
+	if err := l.Set("^java-.*,myregistry/java:latest"); err != nil {
+		t.Fatalf("Set() = %v, want nil", err)
+	}
+	if err := l.Set("bad-value"); err == nil {
+		t.Fatal("Set(\"bad-value\") = nil, want error for a missing comma")
+	}
+	if err := l.Set("[,image"); err == nil {
+		t.Fatal("Set(\"[,image\") = nil, want error for an invalid regex")
+	}
+
+	want := []ContainerImageOverride{{Pattern: "^java-.*", Image: "myregistry/java:latest"}}
+	if len(l) != 1 || l[0] != want[0] {
+		t.Fatalf("after Set(), l = %+v, want %+v", l, want)
+	}
+	if got, want := l.String(), "^java-.*,myregistry/java:latest"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestGetPipelineOptions(t *testing.T) {
+	oldFile, oldOpts := *PipelineOptionsFile, PipelineOptions
+	defer func() { *PipelineOptionsFile, PipelineOptions = oldFile, oldOpts }()
+
+	dir := t.TempDir()
+	file := dir + "/options.json"
+	if err := ioutil.WriteFile(file, []byte(`{"parallelism":"4","master":"local"}`), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	*PipelineOptionsFile = file
+	PipelineOptions = pipelineOptionList{"master": "yarn"}
+
+	got, err := GetPipelineOptions()
+	if err != nil {
+		t.Fatalf("GetPipelineOptions() = %v, want nil error", err)
+	}
+	if got.GetFields()["parallelism"].GetStringValue() != "4" {
+		t.Errorf("parallelism = %q, want %q (from file)", got.GetFields()["parallelism"].GetStringValue(), "4")
+	}
+	if got.GetFields()["master"].GetStringValue() != "yarn" {
+		t.Errorf("master = %q, want %q (flag overrides file)", got.GetFields()["master"].GetStringValue(), "yarn")
+	}
+}
+
+func TestPipelineOptionListSetString(t *testing.T) {
+	var l pipelineOptionList
+	if err := l.Set("parallelism=4"); err != nil {
+		t.Fatalf("Set() = %v, want nil", err)
+	}
+	if err := l.Set("novalue"); err == nil {
+		t.Fatal("Set(\"novalue\") = nil, want error for a missing \"=\"")
+	}
+	if got, want := l["parallelism"], "4"; got != want {
+		t.Errorf("l[\"parallelism\"] = %q, want %q", got, want)
+	}
+	if got, want := l.String(), "parallelism=4"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestGetArtifactEndpoint(t *testing.T) {
+	oldEndpoint, oldArtifactEndpoint := *Endpoint, *ArtifactEndpoint
+	defer func() { *Endpoint, *ArtifactEndpoint = oldEndpoint, oldArtifactEndpoint }()
+
+	*Endpoint = "job.example.com:443"
+	*ArtifactEndpoint = ""
+	if got, want := GetArtifactEndpoint(), "job.example.com:443"; got != want {
+		t.Errorf("GetArtifactEndpoint() = %q, want %q (fallback to Endpoint)", got, want)
+	}
+
+	*ArtifactEndpoint = "artifacts.example.com:443"
+	if got, want := GetArtifactEndpoint(), "artifacts.example.com:443"; got != want {
+		t.Errorf("GetArtifactEndpoint() = %q, want %q", got, want)
+	}
+}
+
+func TestWithRetry_EnforcesSubmitTimeout(t *testing.T) {
+	oldTimeout, oldRetries := *JobSubmitTimeout, *MaxSubmitRetries
+	defer func() { *JobSubmitTimeout, *MaxSubmitRetries = oldTimeout, oldRetries }()
+	*JobSubmitTimeout = 20 * time.Millisecond
+	*MaxSubmitRetries = 0
+
+	start := time.Now()
+	err := WithRetry(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("WithRetry() = nil, want error from a timed-out attempt")
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("WithRetry took %v; GetSubmitTimeout does not appear to bound the attempt", elapsed)
+	}
+}
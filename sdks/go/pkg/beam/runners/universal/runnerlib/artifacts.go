@@ -0,0 +1,107 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runnerlib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pipepb "github.com/apache/beam/sdks/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/options/jobopts"
+	"github.com/golang/protobuf/proto"
+)
+
+// BuildArtifactInformation builds a pipepb.ArtifactInformation for source (a
+// filesystem path or HTTP(S) URL, depending on --artifact_type) so it can be
+// attached to the Go SDK's environment without shipping bytes through the
+// SDK for every staging scheme. It is called unconditionally by PrepareJob;
+// source may be empty, and each --artifact_type case below decides for
+// itself whether that's a configuration error or simply nothing to do.
+//
+// "file" and "url" return (nil, nil) when source is empty: there is nothing
+// to stage, and this is the default --artifact_type, so a caller that never
+// touched any artifact flag must not get a spurious empty-path artifact.
+//
+// "embedded" artifacts are assumed to already be present in the SDK harness
+// container, so staging is always skipped, regardless of source.
+//
+// Any other --artifact_type, including "maven" and "pypi", is rejected: the
+// portable ArtifactInformation protocol this SDK speaks has no generic
+// maven/pypi artifact type urn, so this returns an explicit error rather
+// than fabricating a non-standard payload.
+//
+// If --dry_run_artifacts is set, a valid, non-empty request logs what would
+// have been staged instead of staging it; an invalid --artifact_type still
+// returns its error so dry runs surface configuration mistakes rather than
+// masking them.
+func BuildArtifactInformation(ctx context.Context, source string) (*pipepb.ArtifactInformation, error) {
+	switch t := strings.ToLower(*jobopts.ArtifactType); t {
+	case "file":
+		if source == "" {
+			return nil, nil
+		}
+		if *jobopts.DryRunArtifacts {
+			log.Infof(ctx, "[dry run] would stage file artifact %q via %v", source, jobopts.GetArtifactEndpoint())
+			return nil, nil
+		}
+		payload, err := proto.Marshal(&pipepb.ArtifactFilePayload{Path: source})
+		if err != nil {
+			return nil, err
+		}
+		return &pipepb.ArtifactInformation{TypeUrn: "beam:artifact:type:file:v1", TypePayload: payload}, nil
+
+	case "url":
+		if source == "" {
+			return nil, nil
+		}
+		if *jobopts.DryRunArtifacts {
+			log.Infof(ctx, "[dry run] would stage url artifact %q via %v", source, jobopts.GetArtifactEndpoint())
+			return nil, nil
+		}
+		payload, err := proto.Marshal(&pipepb.ArtifactUrlPayload{Url: source})
+		if err != nil {
+			return nil, err
+		}
+		return &pipepb.ArtifactInformation{TypeUrn: "beam:artifact:type:url:v1", TypePayload: payload}, nil
+
+	case "embedded":
+		if *jobopts.DryRunArtifacts {
+			log.Infof(ctx, "[dry run] %q is embedded in the SDK harness container; nothing to stage", source)
+			return nil, nil
+		}
+		log.Infof(ctx, "Artifact %q is embedded in the SDK harness container; skipping staging", source)
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown --artifact_type %q, want file, url, or embedded", t)
+	}
+}
+
+// attachArtifact adds info as a dependency of the Go SDK's own environment
+// (defaultEnvironmentID), not every environment in the pipeline: a
+// cross-language pipeline's Java or Python environments have no use for an
+// artifact staged by this SDK, and attaching it there would push an
+// incompatible dependency onto a foreign harness.
+func attachArtifact(pipeline *pipepb.Pipeline, info *pipepb.ArtifactInformation) error {
+	env, ok := pipeline.GetComponents().GetEnvironments()[defaultEnvironmentID]
+	if !ok {
+		return fmt.Errorf("no environment with id %q to attach a staged artifact to", defaultEnvironmentID)
+	}
+	env.Dependencies = append(env.Dependencies, info)
+	return nil
+}
@@ -0,0 +1,106 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runnerlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pipepb "github.com/apache/beam/sdks/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/options/jobopts"
+	"github.com/golang/protobuf/proto"
+)
+
+// defaultEnvironmentID is the id the Go SDK assigns its single SDK harness
+// environment before it is placed in a pipeline's component map, so that
+// --sdk_harness_container_image_override patterns have an id to match
+// against even at this single-environment construction stage.
+const defaultEnvironmentID = "go"
+
+// GetEnvironment returns the pipepb.Environment to run the SDK harness in,
+// driven by --environment_type and --environment_config. It supersedes the
+// DOCKER-only jobopts.GetContainerImage for callers that need PROCESS or
+// EXTERNAL environments as well. For DOCKER, it also applies any matching
+// --sdk_harness_container_image_override (see ApplyContainerImageOverrides
+// for the equivalent rewrite once an environment has a real
+// pipeline-assigned id).
+//
+// --environment_type=LOOPBACK is accepted as a flag value, but
+// GetEnvironment returns a "not implemented" error for it: no in-process
+// FnApiWorker gRPC server is started and no ExternalPayload is produced.
+func GetEnvironment(ctx context.Context) (*pipepb.Environment, error) {
+	switch t := jobopts.GetEnvironmentType(); t {
+	case "DOCKER":
+		image := jobopts.GetContainerImage(ctx)
+		override, err := selectOverrideImage(jobopts.GetContainerImageOverrides(), defaultEnvironmentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --sdk_harness_container_image_override: %w", err)
+		}
+		if override != "" {
+			log.Infof(ctx, "Overriding container image for environment %q: %q -> %q", defaultEnvironmentID, image, override)
+			image = override
+		}
+		payload, err := proto.Marshal(&pipepb.DockerPayload{ContainerImage: image})
+		if err != nil {
+			return nil, err
+		}
+		return &pipepb.Environment{Urn: "beam:env:docker:v1", Payload: payload}, nil
+
+	case "PROCESS":
+		var cfg struct {
+			OS      string            `json:"os"`
+			Arch    string            `json:"arch"`
+			Command string            `json:"command"`
+			Env     map[string]string `json:"env"`
+		}
+		if err := parseEnvironmentConfig(ctx, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid --environment_config for PROCESS: %w", err)
+		}
+		payload, err := proto.Marshal(&pipepb.ProcessPayload{Os: cfg.OS, Arch: cfg.Arch, Command: cfg.Command, Env: cfg.Env})
+		if err != nil {
+			return nil, err
+		}
+		return &pipepb.Environment{Urn: "beam:env:process:v1", Payload: payload}, nil
+
+	case "EXTERNAL":
+		endpoint := jobopts.GetEnvironmentConfig(ctx)
+		payload, err := proto.Marshal(&pipepb.ExternalPayload{Endpoint: &pipepb.ApiServiceDescriptor{Url: endpoint}})
+		if err != nil {
+			return nil, err
+		}
+		return &pipepb.Environment{Urn: "beam:env:external:v1", Payload: payload}, nil
+
+	case "LOOPBACK":
+		// runnerlib starts no in-process FnApiWorker gRPC server, so there is
+		// no endpoint to return as an ExternalPayload for LOOPBACK.
+		return nil, fmt.Errorf("LOOPBACK environment is not implemented: runnerlib starts no in-process FnApiWorker gRPC server to return as an ExternalPayload")
+
+	default:
+		return nil, fmt.Errorf("unknown --environment_type %q, want DOCKER, PROCESS, EXTERNAL, or LOOPBACK", t)
+	}
+}
+
+// parseEnvironmentConfig parses --environment_config as JSON into cfg. An
+// empty config leaves cfg unmodified.
+func parseEnvironmentConfig(ctx context.Context, cfg interface{}) error {
+	raw := jobopts.GetEnvironmentConfig(ctx)
+	if raw == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), cfg)
+}
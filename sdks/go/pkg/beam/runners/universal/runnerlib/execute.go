@@ -0,0 +1,96 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runnerlib
+
+import (
+	"context"
+	"fmt"
+
+	jobpb "github.com/apache/beam/sdks/go/pkg/beam/model/jobmanagement_v1"
+	pipepb "github.com/apache/beam/sdks/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/options/jobopts"
+	"google.golang.org/grpc"
+)
+
+// PrepareJob stages the given pipeline with the job service behind conn and
+// submits it for execution, returning a JobHandle for the running job.
+//
+// Before submission it applies --sdk_harness_container_image_override
+// rewrites to the pipeline's environments (see ApplyContainerImageOverrides),
+// merges --pipeline_option/--pipeline_options_file into the request (see
+// jobopts.GetPipelineOptions) so runner-specific knobs like Flink
+// parallelism or a Spark master URL reach the job service without a
+// dedicated flag, and builds an artifact dependency per --artifact_type
+// (see BuildArtifactInformation); an empty --artifact_staging_path adds no
+// dependency for any type. It bounds the Prepare and Run
+// RPCs with jobopts.WithRetry so a flaky job service cannot hang submission
+// indefinitely.
+func PrepareJob(ctx context.Context, conn *grpc.ClientConn, pipeline *pipepb.Pipeline) (*JobHandle, error) {
+	if _, err := ApplyContainerImageOverrides(ctx, pipeline); err != nil {
+		return nil, fmt.Errorf("failed to apply container image overrides: %w", err)
+	}
+
+	info, err := BuildArtifactInformation(ctx, *jobopts.ArtifactStagingPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build artifact information for %q: %w", *jobopts.ArtifactStagingPath, err)
+	}
+	if info != nil {
+		if err := attachArtifact(pipeline, info); err != nil {
+			return nil, fmt.Errorf("failed to attach staged artifact: %w", err)
+		}
+	}
+
+	options, err := jobopts.GetPipelineOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build pipeline options: %w", err)
+	}
+
+	client := jobpb.NewJobServiceClient(conn)
+
+	req := &jobpb.PrepareJobRequest{
+		JobName:         jobopts.GetJobName(),
+		Pipeline:        pipeline,
+		PipelineOptions: options,
+	}
+
+	var prepareResp *jobpb.PrepareJobResponse
+	if err := jobopts.WithRetry(ctx, func(ctx context.Context) error {
+		resp, err := client.Prepare(ctx, req)
+		prepareResp = resp
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to prepare job %v: %w", req.GetJobName(), err)
+	}
+
+	retrievalToken := *jobopts.RetrievalToken
+	if retrievalToken == "" {
+		retrievalToken = prepareResp.GetStagingSessionToken()
+	}
+
+	var runResp *jobpb.RunJobResponse
+	if err := jobopts.WithRetry(ctx, func(ctx context.Context) error {
+		resp, err := client.Run(ctx, &jobpb.RunJobRequest{
+			PreparationId:  prepareResp.GetPreparationId(),
+			RetrievalToken: retrievalToken,
+		})
+		runResp = resp
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to run job %v: %w", req.GetJobName(), err)
+	}
+
+	return NewJobHandle(runResp.GetJobId(), conn), nil
+}
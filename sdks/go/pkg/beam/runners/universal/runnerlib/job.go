@@ -0,0 +1,147 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runnerlib contains utilities for submitting and controlling jobs
+// on a portable Beam job service, used by the universal runner.
+package runnerlib
+
+import (
+	"context"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	"github.com/apache/beam/sdks/go/pkg/beam/model/jobmanagement_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/options/jobopts"
+	"google.golang.org/grpc"
+)
+
+// JobHandle is a live handle to a job submitted to a portable job service. It
+// allows the submitter to cancel or drain the job and to tail its message
+// and state streams after Run has returned, without dropping to raw gRPC.
+type JobHandle struct {
+	id     string
+	client jobmanagement_v1.JobServiceClient
+}
+
+// NewJobHandle returns a handle for the given job id, speaking to the job
+// service over the given connection.
+func NewJobHandle(id string, conn *grpc.ClientConn) *JobHandle {
+	return &JobHandle{id: id, client: jobmanagement_v1.NewJobServiceClient(conn)}
+}
+
+// ID returns the job id.
+func (h *JobHandle) ID() string {
+	return h.id
+}
+
+// CancelJob requests that the job service cancel the job, waiting up to
+// jobopts.GetCancelTimeout for the request to be acknowledged.
+func CancelJob(ctx context.Context, h *JobHandle) error {
+	ctx, cancel := context.WithTimeout(ctx, jobopts.GetCancelTimeout())
+	defer cancel()
+
+	_, err := h.client.Cancel(ctx, &jobmanagement_v1.CancelJobRequest{JobId: h.id})
+	return err
+}
+
+// DrainJob sends the job service the same Cancel RPC as CancelJob, whether
+// or not --enable_job_drain is set; the flag changes only the logged
+// message. No separate drain request is made, so whether in-flight data is
+// allowed to finish depends on how the runner handles Cancel.
+func DrainJob(ctx context.Context, h *JobHandle) error {
+	if !*jobopts.EnableJobDrain {
+		log.Infof(ctx, "Job drain not enabled; cancelling job %v instead", h.id)
+	} else {
+		log.Infof(ctx, "Requesting cancellation of job %v for drain; whether in-flight data is allowed to finish depends on the runner", h.id)
+	}
+	return CancelJob(ctx, h)
+}
+
+// JobMessage is a single message or state transition streamed from a running
+// job, filtered down to what callers typically need.
+type JobMessage struct {
+	// Severity is the message importance name, e.g. "JOB_MESSAGE_WARNING".
+	// Empty for state updates.
+	Severity string
+	// Text is the human-readable message text. Empty for pure state updates.
+	Text string
+	// State is the job's current state, if this message is a state update.
+	State string
+}
+
+// StreamJobMessages tails the job service's message and state streams for
+// the given job, returning a channel of messages at or above minSeverity.
+// The channel is closed when ctx is cancelled or the streams end.
+func StreamJobMessages(ctx context.Context, h *JobHandle, minSeverity string) (<-chan JobMessage, error) {
+	stream, err := h.client.GetMessageStream(ctx, &jobmanagement_v1.JobMessagesRequest{JobId: h.id})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan JobMessage)
+	go func() {
+		defer close(out)
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Errorf(ctx, "job %v message stream ended: %v", h.id, err)
+				}
+				return
+			}
+
+			var msg JobMessage
+			isState := false
+			switch {
+			case resp.GetMessageResponse() != nil:
+				m := resp.GetMessageResponse()
+				msg = JobMessage{Severity: m.GetImportance().String(), Text: m.GetMessageText()}
+			case resp.GetStateResponse() != nil:
+				msg = JobMessage{State: resp.GetStateResponse().GetState().String()}
+				isState = true
+			default:
+				continue
+			}
+			// State transitions (e.g. the job finishing or failing) always
+			// pass the filter: they carry no Severity of their own, and a
+			// caller watching for completion must not lose them just
+			// because they asked for, say, WARNING and above.
+			if !isState && !severityAtLeast(msg.Severity, minSeverity) {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+var severityRank = map[string]int{
+	"JOB_MESSAGE_DEBUG":   0,
+	"JOB_MESSAGE_DETAIL":  1,
+	"JOB_MESSAGE_BASIC":   2,
+	"JOB_MESSAGE_WARNING": 3,
+	"JOB_MESSAGE_ERROR":   4,
+}
+
+func severityAtLeast(severity, min string) bool {
+	if min == "" {
+		return true
+	}
+	return severityRank[severity] >= severityRank[min]
+}
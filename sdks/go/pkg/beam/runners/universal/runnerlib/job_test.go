@@ -0,0 +1,35 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runnerlib
+
+import "testing"
+
+func TestSeverityAtLeast(t *testing.T) {
+	tests := []struct {
+		severity, min string
+		want          bool
+	}{
+		{"JOB_MESSAGE_ERROR", "JOB_MESSAGE_WARNING", true},
+		{"JOB_MESSAGE_DEBUG", "JOB_MESSAGE_WARNING", false},
+		{"JOB_MESSAGE_WARNING", "JOB_MESSAGE_WARNING", true},
+		{"anything", "", true},
+	}
+	for _, tc := range tests {
+		if got := severityAtLeast(tc.severity, tc.min); got != tc.want {
+			t.Errorf("severityAtLeast(%q, %q) = %v, want %v", tc.severity, tc.min, got, tc.want)
+		}
+	}
+}
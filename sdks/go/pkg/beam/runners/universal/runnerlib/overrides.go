@@ -0,0 +1,85 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runnerlib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pipepb "github.com/apache/beam/sdks/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/options/jobopts"
+	"github.com/golang/protobuf/proto"
+)
+
+const dockerEnvironmentURN = "beam:env:docker:v1"
+
+// ApplyContainerImageOverrides rewrites the SDK harness container image of
+// every DOCKER environment in pipeline whose environment id matches one of
+// the --sdk_harness_container_image_override patterns. This is what lets a
+// cross-language pipeline give the Go SDK harness, the Java expansion
+// harness, and any Python harness distinct images (e.g. private registry
+// mirrors) even though they all started out pointing at their SDKs'
+// default containers. It returns the number of environments rewritten.
+func ApplyContainerImageOverrides(ctx context.Context, pipeline *pipepb.Pipeline) (int, error) {
+	overrides := jobopts.GetContainerImageOverrides()
+	if len(overrides) == 0 {
+		return 0, nil
+	}
+
+	rewritten := 0
+	for envID, env := range pipeline.GetComponents().GetEnvironments() {
+		if env.GetUrn() != dockerEnvironmentURN {
+			continue
+		}
+		image, err := selectOverrideImage(overrides, envID)
+		if err != nil {
+			return rewritten, err
+		}
+		if image == "" {
+			continue
+		}
+
+		var payload pipepb.DockerPayload
+		if err := proto.Unmarshal(env.GetPayload(), &payload); err != nil {
+			return rewritten, fmt.Errorf("failed to parse docker payload for environment %q: %w", envID, err)
+		}
+		log.Infof(ctx, "Overriding container image for environment %q: %q -> %q", envID, payload.GetContainerImage(), image)
+		payload.ContainerImage = image
+		data, err := proto.Marshal(&payload)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to re-marshal docker payload for environment %q: %w", envID, err)
+		}
+		env.Payload = data
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// selectOverrideImage returns the replacement image for envID, or "" if no
+// override matches.
+func selectOverrideImage(overrides []jobopts.ContainerImageOverride, envID string) (string, error) {
+	for _, o := range overrides {
+		ok, err := o.Matches(envID)
+		if err != nil {
+			return "", fmt.Errorf("invalid container image override pattern %q: %w", o.Pattern, err)
+		}
+		if ok {
+			return o.Image, nil
+		}
+	}
+	return "", nil
+}
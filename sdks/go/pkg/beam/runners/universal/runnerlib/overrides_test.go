@@ -0,0 +1,60 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runnerlib
+
+import (
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/options/jobopts"
+)
+
+func TestDefaultEnvironmentIDMatchesOverride(t *testing.T) {
+	overrides := []jobopts.ContainerImageOverride{
+		{Pattern: "^go$", Image: "myregistry/go:latest"},
+	}
+	got, err := selectOverrideImage(overrides, defaultEnvironmentID)
+	if err != nil {
+		t.Fatalf("selectOverrideImage(%q) returned error: %v", defaultEnvironmentID, err)
+	}
+	if want := "myregistry/go:latest"; got != want {
+		t.Errorf("selectOverrideImage(%q) = %q, want %q; GetEnvironment's DOCKER branch depends on this id matching", defaultEnvironmentID, got, want)
+	}
+}
+
+func TestSelectOverrideImage(t *testing.T) {
+	overrides := []jobopts.ContainerImageOverride{
+		{Pattern: "^java-.*", Image: "myregistry/java:latest"},
+		{Pattern: "^go$", Image: "myregistry/go:latest"},
+	}
+
+	tests := []struct {
+		envID string
+		want  string
+	}{
+		{"java-expansion-1", "myregistry/java:latest"},
+		{"go", "myregistry/go:latest"},
+		{"python-1", ""},
+	}
+	for _, tc := range tests {
+		got, err := selectOverrideImage(overrides, tc.envID)
+		if err != nil {
+			t.Fatalf("selectOverrideImage(%q) returned error: %v", tc.envID, err)
+		}
+		if got != tc.want {
+			t.Errorf("selectOverrideImage(%q) = %q, want %q", tc.envID, got, tc.want)
+		}
+	}
+}